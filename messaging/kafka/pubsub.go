@@ -0,0 +1,144 @@
+// Package kafka holds the Kafka implementation of the messaging.PubSub
+// interface.
+package kafka
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/mainflux/mainflux/messaging"
+	kafka "github.com/segmentio/kafka-go"
+)
+
+var _ messaging.PubSub = (*pubsub)(nil)
+
+// topic is the single physical Kafka topic every mainflux subject is
+// multiplexed onto. Kafka topic names are literal strings with no
+// wildcard support, unlike the NATS-style "channels.>" subjects the rest
+// of messaging subscribes with, so a subject can't be used as a Kafka
+// topic name directly. Instead every message carries its real subject as
+// its Kafka key, and Subscribe filters the shared topic client-side.
+const topic = "mainflux"
+
+type pubsub struct {
+	url     string
+	writer  *kafka.Writer
+	mu      sync.Mutex
+	readers map[string]*kafka.Reader
+}
+
+// New returns a Kafka-backed messaging.PubSub connected to the broker(s) at url.
+func New(url string) (messaging.PubSub, error) {
+	writer := &kafka.Writer{
+		Addr:     kafka.TCP(url),
+		Balancer: &kafka.LeastBytes{},
+	}
+
+	return &pubsub{
+		url:     url,
+		writer:  writer,
+		readers: make(map[string]*kafka.Reader),
+	}, nil
+}
+
+func (ps *pubsub) Publish(subject string, msg messaging.Message) error {
+	data, err := proto.Marshal(&msg)
+	if err != nil {
+		return err
+	}
+
+	return ps.writer.WriteMessages(context.Background(), kafka.Message{
+		Topic: topic,
+		Key:   []byte(subject),
+		Value: data,
+	})
+}
+
+func (ps *pubsub) Subscribe(subject string, handler messaging.MessageHandler) error {
+	reader := kafka.NewReader(kafka.ReaderConfig{
+		Brokers: []string{ps.url},
+		Topic:   topic,
+		GroupID: groupID(subject),
+	})
+
+	ps.mu.Lock()
+	ps.readers[subject] = reader
+	ps.mu.Unlock()
+
+	go func() {
+		for {
+			m, err := reader.ReadMessage(context.Background())
+			if err != nil {
+				return
+			}
+			if !subjectMatches(subject, string(m.Key)) {
+				continue
+			}
+
+			var msg messaging.Message
+			if err := proto.Unmarshal(m.Value, &msg); err != nil {
+				continue
+			}
+			handler(msg)
+		}
+	}()
+
+	return nil
+}
+
+func (ps *pubsub) Unsubscribe(subject string) error {
+	ps.mu.Lock()
+	reader, ok := ps.readers[subject]
+	delete(ps.readers, subject)
+	ps.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("not subscribed to topic %s", subject)
+	}
+
+	return reader.Close()
+}
+
+// groupID returns a Kafka consumer-group id unique to one Subscribe call,
+// derived from subject for readability with a random suffix. Kafka
+// load-balances partitions between members of the same group, but
+// messaging.PubSub's fan-out contract requires every independent
+// subscriber to the same subject to receive every message, so no two
+// subscriptions may ever share a group.
+func groupID(subject string) string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return subject
+	}
+	return subject + "-" + hex.EncodeToString(b)
+}
+
+// subjectMatches reports whether key, the literal subject a message was
+// published with, falls under subject, a subscription subject that may
+// end in the ".>" wildcard meaning "everything beneath the subject before
+// it, but not that subject itself", as in NATS.
+func subjectMatches(subject, key string) bool {
+	if subject == key {
+		return true
+	}
+	prefix := strings.TrimSuffix(subject, ">")
+	if prefix == subject {
+		return false
+	}
+	return strings.HasPrefix(key, prefix)
+}
+
+func (ps *pubsub) Close() {
+	ps.writer.Close()
+
+	ps.mu.Lock()
+	defer ps.mu.Unlock()
+	for _, reader := range ps.readers {
+		reader.Close()
+	}
+}
@@ -0,0 +1,39 @@
+package kafka
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestSubjectMatches(t *testing.T) {
+	cases := []struct {
+		subject string
+		key     string
+		want    bool
+	}{
+		{"channels.1.messages", "channels.1.messages", true},
+		{"channels.1.messages", "channels.1.messages.temp", false},
+		{"channels.1.messages.>", "channels.1.messages.temp", true},
+		{"channels.1.messages.>", "channels.1.messages.temp.in", true},
+		{"channels.1.messages.>", "channels.2.messages.temp", false},
+		{"channels.>", "channels.1.messages.temp", true},
+	}
+
+	for _, tc := range cases {
+		if got := subjectMatches(tc.subject, tc.key); got != tc.want {
+			t.Errorf("subjectMatches(%q, %q) = %v, want %v", tc.subject, tc.key, got, tc.want)
+		}
+	}
+}
+
+func TestGroupIDUnique(t *testing.T) {
+	a := groupID("channels.1.messages")
+	b := groupID("channels.1.messages")
+
+	if a == b {
+		t.Fatalf("groupID(%q) returned the same id twice: %q", "channels.1.messages", a)
+	}
+	if !strings.HasPrefix(a, "channels.1.messages-") || !strings.HasPrefix(b, "channels.1.messages-") {
+		t.Errorf("groupID(%q) = %q, %q, want both prefixed with the subject", "channels.1.messages", a, b)
+	}
+}
@@ -0,0 +1,78 @@
+// Package nats holds the NATS implementation of the messaging.PubSub
+// interface.
+package nats
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/mainflux/mainflux/messaging"
+	broker "github.com/nats-io/go-nats"
+)
+
+var _ messaging.PubSub = (*pubsub)(nil)
+
+type pubsub struct {
+	conn *broker.Conn
+	mu   sync.Mutex
+	subs map[string]*broker.Subscription
+}
+
+// New returns a NATS-backed messaging.PubSub connected to url.
+func New(url string) (messaging.PubSub, error) {
+	conn, err := broker.Connect(url)
+	if err != nil {
+		return nil, err
+	}
+
+	return &pubsub{
+		conn: conn,
+		subs: make(map[string]*broker.Subscription),
+	}, nil
+}
+
+func (ps *pubsub) Publish(topic string, msg messaging.Message) error {
+	data, err := proto.Marshal(&msg)
+	if err != nil {
+		return err
+	}
+
+	return ps.conn.Publish(topic, data)
+}
+
+func (ps *pubsub) Subscribe(topic string, handler messaging.MessageHandler) error {
+	sub, err := ps.conn.Subscribe(topic, func(m *broker.Msg) {
+		var msg messaging.Message
+		if err := proto.Unmarshal(m.Data, &msg); err != nil {
+			return
+		}
+		handler(msg)
+	})
+	if err != nil {
+		return err
+	}
+
+	ps.mu.Lock()
+	ps.subs[topic] = sub
+	ps.mu.Unlock()
+
+	return nil
+}
+
+func (ps *pubsub) Unsubscribe(topic string) error {
+	ps.mu.Lock()
+	sub, ok := ps.subs[topic]
+	delete(ps.subs, topic)
+	ps.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("not subscribed to topic %s", topic)
+	}
+
+	return sub.Unsubscribe()
+}
+
+func (ps *pubsub) Close() {
+	ps.conn.Close()
+}
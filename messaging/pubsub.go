@@ -0,0 +1,35 @@
+// Package messaging contains the broker-agnostic abstraction used to publish
+// and subscribe to Mainflux messages. Concrete implementations live in the
+// messaging/nats, messaging/kafka and messaging/rabbitmq subpackages so that
+// upstream services (ws, writers, ...) never depend on a specific broker.
+package messaging
+
+// MessageHandler is invoked for every message delivered on a subscription,
+// regardless of which broker produced it.
+type MessageHandler func(msg Message) error
+
+// Publisher specifies a message publishing API.
+type Publisher interface {
+	// Publish publishes message to the given topic.
+	Publish(topic string, msg Message) error
+}
+
+// Subscriber specifies a message subscription API.
+type Subscriber interface {
+	// Subscribe subscribes to the given topic and invokes handler for every
+	// received message.
+	Subscribe(topic string, handler MessageHandler) error
+
+	// Unsubscribe cancels a previously established subscription to topic.
+	Unsubscribe(topic string) error
+}
+
+// PubSub combines message publishing and subscribing into a single
+// broker-agnostic API.
+type PubSub interface {
+	Publisher
+	Subscriber
+
+	// Close gracefully closes the connection to the broker.
+	Close()
+}
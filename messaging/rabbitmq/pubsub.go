@@ -0,0 +1,135 @@
+// Package rabbitmq holds the RabbitMQ implementation of the messaging.PubSub
+// interface.
+package rabbitmq
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/mainflux/mainflux/messaging"
+	amqp "github.com/streadway/amqp"
+)
+
+const exchangeName = "mainflux"
+
+var _ messaging.PubSub = (*pubsub)(nil)
+
+type pubsub struct {
+	conn *amqp.Connection
+	ch   *amqp.Channel
+	mu   sync.Mutex
+	subs map[string]chan bool
+}
+
+// New returns a RabbitMQ-backed messaging.PubSub connected to url.
+func New(url string) (messaging.PubSub, error) {
+	conn, err := amqp.Dial(url)
+	if err != nil {
+		return nil, err
+	}
+
+	ch, err := conn.Channel()
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	if err := ch.ExchangeDeclare(exchangeName, amqp.ExchangeTopic, true, false, false, false, nil); err != nil {
+		ch.Close()
+		conn.Close()
+		return nil, err
+	}
+
+	return &pubsub{
+		conn: conn,
+		ch:   ch,
+		subs: make(map[string]chan bool),
+	}, nil
+}
+
+func (ps *pubsub) Publish(topic string, msg messaging.Message) error {
+	data, err := proto.Marshal(&msg)
+	if err != nil {
+		return err
+	}
+
+	return ps.ch.Publish(exchangeName, topic, false, false, amqp.Publishing{
+		ContentType: "application/octet-stream",
+		Body:        data,
+	})
+}
+
+func (ps *pubsub) Subscribe(topic string, handler messaging.MessageHandler) error {
+	q, err := ps.ch.QueueDeclare("", false, true, true, false, nil)
+	if err != nil {
+		return err
+	}
+
+	if err := ps.ch.QueueBind(q.Name, bindingKey(topic), exchangeName, false, nil); err != nil {
+		return err
+	}
+
+	msgs, err := ps.ch.Consume(q.Name, "", true, true, false, false, nil)
+	if err != nil {
+		return err
+	}
+
+	done := make(chan bool)
+	ps.mu.Lock()
+	ps.subs[topic] = done
+	ps.mu.Unlock()
+
+	go func() {
+		for {
+			select {
+			case <-done:
+				return
+			case d, ok := <-msgs:
+				if !ok {
+					return
+				}
+				var msg messaging.Message
+				if err := proto.Unmarshal(d.Body, &msg); err != nil {
+					continue
+				}
+				handler(msg)
+			}
+		}
+	}()
+
+	return nil
+}
+
+// bindingKey translates the NATS-style ">" wildcard used throughout
+// messaging (e.g. "channels.1.messages.>", meaning "everything beneath
+// channels.1.messages, but not that subject itself") into its AMQP
+// topic-exchange equivalent, "*.#" (one word, then zero or more), since
+// RabbitMQ routing keys don't understand NATS wildcard syntax and a bare
+// "#" would also match the prefix itself.
+func bindingKey(topic string) string {
+	if !strings.HasSuffix(topic, ">") {
+		return topic
+	}
+	return strings.TrimSuffix(topic, ">") + "*.#"
+}
+
+func (ps *pubsub) Unsubscribe(topic string) error {
+	ps.mu.Lock()
+	done, ok := ps.subs[topic]
+	delete(ps.subs, topic)
+	ps.mu.Unlock()
+
+	if !ok {
+		return fmt.Errorf("not subscribed to topic %s", topic)
+	}
+
+	close(done)
+	return nil
+}
+
+func (ps *pubsub) Close() {
+	ps.ch.Close()
+	ps.conn.Close()
+}
@@ -0,0 +1,20 @@
+package rabbitmq
+
+import "testing"
+
+func TestBindingKey(t *testing.T) {
+	cases := []struct {
+		topic string
+		want  string
+	}{
+		{"channels.1.messages", "channels.1.messages"},
+		{"channels.1.messages.>", "channels.1.messages.*.#"},
+		{"channels.>", "channels.*.#"},
+	}
+
+	for _, tc := range cases {
+		if got := bindingKey(tc.topic); got != tc.want {
+			t.Errorf("bindingKey(%q) = %q, want %q", tc.topic, got, tc.want)
+		}
+	}
+}
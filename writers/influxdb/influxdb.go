@@ -0,0 +1,224 @@
+// Package influxdb implements a writers.MessageRepository that batches
+// messages into InfluxDB BatchPoints before writing them, retrying failed
+// writes with backoff and spooling to an on-disk WAL when retries are
+// exhausted.
+package influxdb
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	influxdata "github.com/influxdata/influxdb/client/v2"
+	"github.com/mainflux/mainflux/messaging"
+	"github.com/mainflux/mainflux/writers"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const defPrecision = "ns"
+
+var (
+	batchSizeGauge = promauto.NewGauge(stdprometheus.GaugeOpts{
+		Namespace: "influxdb",
+		Subsystem: "message_writer",
+		Name:      "batch_size",
+		Help:      "Number of points in the most recently flushed batch.",
+	})
+	flushLatency = promauto.NewHistogram(stdprometheus.HistogramOpts{
+		Namespace: "influxdb",
+		Subsystem: "message_writer",
+		Name:      "flush_latency_seconds",
+		Help:      "Time taken to write a batch to InfluxDB, including retries.",
+	})
+	retriesCounter = promauto.NewCounter(stdprometheus.CounterOpts{
+		Namespace: "influxdb",
+		Subsystem: "message_writer",
+		Name:      "retries_total",
+		Help:      "Total number of batch write retries.",
+	})
+	walDepthGauge = promauto.NewGauge(stdprometheus.GaugeOpts{
+		Namespace: "influxdb",
+		Subsystem: "message_writer",
+		Name:      "wal_depth",
+		Help:      "Number of batches currently spooled in the WAL.",
+	})
+)
+
+// Config configures batching, retry, and WAL-spooling behavior of the
+// InfluxDB writer.
+type Config struct {
+	// BatchSize is the number of points buffered before a flush is forced.
+	BatchSize int
+	// BatchTimeout flushes a non-empty, below-threshold batch after this long.
+	BatchTimeout time.Duration
+	// MaxRetries bounds the number of retries after a batch's first failed
+	// write attempt before it is spooled to the WAL.
+	MaxRetries int
+	// WALDir is the directory batches are spooled to when every retry fails.
+	WALDir string
+}
+
+type repository struct {
+	client      influxdata.Client
+	database    string
+	measurement string
+	cfg         Config
+	points      chan *influxdata.Point
+	wal         *wal
+}
+
+// New returns a writers.MessageRepository that persists messages to the
+// InfluxDB database and measurement identified by database and measurement.
+func New(client influxdata.Client, database, measurement string, cfg Config) (writers.MessageRepository, error) {
+	w, err := newWAL(cfg.WALDir)
+	if err != nil {
+		return nil, err
+	}
+
+	repo := &repository{
+		client:      client,
+		database:    database,
+		measurement: measurement,
+		cfg:         cfg,
+		points:      make(chan *influxdata.Point, cfg.BatchSize*2),
+		wal:         w,
+	}
+
+	go repo.run()
+	go repo.drainWAL()
+
+	return repo, nil
+}
+
+// Save converts msg to an InfluxDB point and enqueues it for the next batch
+// flush. It returns an error, providing backpressure to the caller, when the
+// internal buffer is full.
+func (r *repository) Save(msg messaging.Message) error {
+	pt, err := r.point(msg)
+	if err != nil {
+		return err
+	}
+
+	select {
+	case r.points <- pt:
+		return nil
+	default:
+		return fmt.Errorf("influxdb writer backlog full, dropping message")
+	}
+}
+
+func (r *repository) point(msg messaging.Message) (*influxdata.Point, error) {
+	tags := map[string]string{
+		"channel":   msg.Channel,
+		"subtopic":  msg.Subtopic,
+		"publisher": msg.Publisher,
+		"protocol":  msg.Protocol,
+	}
+	fields := map[string]interface{}{
+		"payload":      string(msg.Payload),
+		"content_type": msg.ContentType,
+	}
+
+	return influxdata.NewPoint(r.measurement, tags, fields, time.Unix(0, msg.Created))
+}
+
+// run buffers incoming points and flushes them on either the configured
+// batch size or batch timeout, whichever comes first.
+func (r *repository) run() {
+	batch := make([]*influxdata.Point, 0, r.cfg.BatchSize)
+	ticker := time.NewTicker(r.cfg.BatchTimeout)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case pt := <-r.points:
+			batch = append(batch, pt)
+			if len(batch) >= r.cfg.BatchSize {
+				r.flush(batch)
+				batch = make([]*influxdata.Point, 0, r.cfg.BatchSize)
+			}
+		case <-ticker.C:
+			if len(batch) > 0 {
+				r.flush(batch)
+				batch = make([]*influxdata.Point, 0, r.cfg.BatchSize)
+			}
+		}
+	}
+}
+
+// flush writes batch to InfluxDB, retrying with exponential backoff. If
+// every attempt fails, the batch is spooled to the WAL for later draining.
+func (r *repository) flush(batch []*influxdata.Point) {
+	begin := time.Now()
+	defer func() {
+		flushLatency.Observe(time.Since(begin).Seconds())
+		batchSizeGauge.Set(float64(len(batch)))
+	}()
+
+	backoff := 100 * time.Millisecond
+	const maxBackoff = 30 * time.Second
+
+	for attempt := 0; attempt <= r.cfg.MaxRetries; attempt++ {
+		if attempt > 0 {
+			retriesCounter.Inc()
+			time.Sleep(backoff)
+			backoff = nextBackoff(backoff, maxBackoff)
+		}
+
+		if err := r.write(batch); err == nil {
+			return
+		}
+	}
+
+	if err := r.wal.spool(batch); err != nil {
+		return
+	}
+	walDepthGauge.Set(float64(r.wal.depth()))
+}
+
+// nextBackoff doubles current, capping the result at max.
+func nextBackoff(current, max time.Duration) time.Duration {
+	next := current * 2
+	if next > max {
+		return max
+	}
+	return next
+}
+
+func (r *repository) write(batch []*influxdata.Point) error {
+	bp, err := influxdata.NewBatchPoints(influxdata.BatchPointsConfig{
+		Database:  r.database,
+		Precision: defPrecision,
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, pt := range batch {
+		bp.AddPoint(pt)
+	}
+
+	return r.client.Write(bp)
+}
+
+// drainWAL periodically retries spooled batches, removing them from the WAL
+// once they have been written successfully.
+func (r *repository) drainWAL() {
+	ticker := time.NewTicker(r.cfg.BatchTimeout)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		r.wal.drain(r.write)
+		walDepthGauge.Set(float64(r.wal.depth()))
+	}
+}
+
+// MakeHandler returns an HTTP handler exposing the writer's Prometheus
+// metrics.
+func MakeHandler() http.Handler {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return mux
+}
@@ -0,0 +1,27 @@
+package influxdb
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNextBackoff(t *testing.T) {
+	cases := []struct {
+		name    string
+		current time.Duration
+		max     time.Duration
+		want    time.Duration
+	}{
+		{"doubles below the cap", 100 * time.Millisecond, 30 * time.Second, 200 * time.Millisecond},
+		{"caps at max", 20 * time.Second, 30 * time.Second, 30 * time.Second},
+		{"stays at max once reached", 30 * time.Second, 30 * time.Second, 30 * time.Second},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := nextBackoff(tc.current, tc.max); got != tc.want {
+				t.Errorf("nextBackoff(%s, %s) = %s, want %s", tc.current, tc.max, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,186 @@
+package influxdb
+
+import (
+	"encoding/gob"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	influxdata "github.com/influxdata/influxdb/client/v2"
+)
+
+// maxWALFiles bounds the number of batches the WAL keeps on disk. Once
+// reached, the oldest spooled batch is dropped to make room for the new one.
+const maxWALFiles = 1000
+
+// walRecord is the on-disk representation of a single InfluxDB point.
+type walRecord struct {
+	Measurement string
+	Tags        map[string]string
+	Fields      map[string]interface{}
+	Time        time.Time
+}
+
+// wal spools batches that could not be written to InfluxDB after every retry
+// in flush has been exhausted, so they can be replayed once the database is
+// reachable again.
+type wal struct {
+	mu  sync.Mutex
+	dir string
+	seq uint64
+}
+
+// newWAL ensures dir exists and returns a wal rooted at it. An empty dir
+// disables spooling: batches that exhaust their retries are dropped instead.
+func newWAL(dir string) (*wal, error) {
+	if dir == "" {
+		return &wal{}, nil
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, fmt.Errorf("failed to create influxdb WAL directory: %s", err)
+	}
+
+	return &wal{dir: dir}, nil
+}
+
+// spool persists batch to disk, evicting the oldest spooled batch first if
+// the WAL is already at capacity.
+func (w *wal) spool(batch []*influxdata.Point) error {
+	if w.dir == "" {
+		return nil
+	}
+
+	records := make([]walRecord, len(batch))
+	for i, pt := range batch {
+		fields, err := pt.Fields()
+		if err != nil {
+			return err
+		}
+		records[i] = walRecord{
+			Measurement: pt.Name(),
+			Tags:        pt.Tags(),
+			Fields:      fields,
+			Time:        pt.Time(),
+		}
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if err := w.evictOldestLocked(); err != nil {
+		return err
+	}
+
+	w.seq++
+	f, err := os.Create(filepath.Join(w.dir, fmt.Sprintf("%020d.wal", w.seq)))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	return gob.NewEncoder(f).Encode(records)
+}
+
+// depth returns the number of batches currently spooled.
+func (w *wal) depth() int {
+	if w.dir == "" {
+		return 0
+	}
+
+	entries, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		return 0
+	}
+
+	return len(entries)
+}
+
+// drain replays every spooled batch through write, oldest first, removing
+// each file once it has been written successfully. A file that cannot be
+// read back is removed without being written. It stops at the first write
+// failure so the remaining batches are retried, in order, on the next call.
+func (w *wal) drain(write func([]*influxdata.Point) error) {
+	if w.dir == "" {
+		return
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	names, err := w.sortedFilesLocked()
+	if err != nil {
+		return
+	}
+
+	for _, name := range names {
+		path := filepath.Join(w.dir, name)
+
+		batch, err := readWALFile(path)
+		if err != nil {
+			os.Remove(path)
+			continue
+		}
+
+		if err := write(batch); err != nil {
+			return
+		}
+		os.Remove(path)
+	}
+}
+
+func readWALFile(path string) ([]*influxdata.Point, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var records []walRecord
+	if err := gob.NewDecoder(f).Decode(&records); err != nil {
+		return nil, err
+	}
+
+	batch := make([]*influxdata.Point, len(records))
+	for i, rec := range records {
+		pt, err := influxdata.NewPoint(rec.Measurement, rec.Tags, rec.Fields, rec.Time)
+		if err != nil {
+			return nil, err
+		}
+		batch[i] = pt
+	}
+
+	return batch, nil
+}
+
+// evictOldestLocked removes the oldest spooled batch once the WAL is at
+// capacity. Callers must hold w.mu.
+func (w *wal) evictOldestLocked() error {
+	names, err := w.sortedFilesLocked()
+	if err != nil {
+		return err
+	}
+	if len(names) < maxWALFiles {
+		return nil
+	}
+
+	return os.Remove(filepath.Join(w.dir, names[0]))
+}
+
+func (w *wal) sortedFilesLocked() ([]string, error) {
+	entries, err := ioutil.ReadDir(w.dir)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	sort.Strings(names)
+
+	return names, nil
+}
@@ -0,0 +1,118 @@
+package influxdb
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	influxdata "github.com/influxdata/influxdb/client/v2"
+)
+
+func newTestPoint(t *testing.T, name string) *influxdata.Point {
+	t.Helper()
+
+	pt, err := influxdata.NewPoint(name, map[string]string{"channel": "1"}, map[string]interface{}{"payload": "x"})
+	if err != nil {
+		t.Fatalf("failed to build point: %s", err)
+	}
+	return pt
+}
+
+func TestWALSpoolDrainRoundTrip(t *testing.T) {
+	w, err := newWAL(t.TempDir())
+	if err != nil {
+		t.Fatalf("newWAL returned error: %s", err)
+	}
+
+	if err := w.spool([]*influxdata.Point{newTestPoint(t, "a"), newTestPoint(t, "b")}); err != nil {
+		t.Fatalf("spool returned error: %s", err)
+	}
+	if err := w.spool([]*influxdata.Point{newTestPoint(t, "c")}); err != nil {
+		t.Fatalf("spool returned error: %s", err)
+	}
+	if depth := w.depth(); depth != 2 {
+		t.Fatalf("depth() = %d, want 2", depth)
+	}
+
+	var drained [][]*influxdata.Point
+	w.drain(func(batch []*influxdata.Point) error {
+		drained = append(drained, batch)
+		return nil
+	})
+
+	if w.depth() != 0 {
+		t.Fatalf("depth() after drain = %d, want 0", w.depth())
+	}
+	if len(drained) != 2 {
+		t.Fatalf("drained %d batches, want 2", len(drained))
+	}
+	// Batches must drain oldest first.
+	if len(drained[0]) != 2 || drained[0][0].Name() != "a" {
+		t.Errorf("first drained batch = %v, want the 2-point batch spooled first", drained[0])
+	}
+	if len(drained[1]) != 1 || drained[1][0].Name() != "c" {
+		t.Errorf("second drained batch = %v, want the 1-point batch spooled second", drained[1])
+	}
+}
+
+func TestWALDrainStopsAtFirstFailure(t *testing.T) {
+	w, err := newWAL(t.TempDir())
+	if err != nil {
+		t.Fatalf("newWAL returned error: %s", err)
+	}
+
+	if err := w.spool([]*influxdata.Point{newTestPoint(t, "a")}); err != nil {
+		t.Fatalf("spool returned error: %s", err)
+	}
+	if err := w.spool([]*influxdata.Point{newTestPoint(t, "b")}); err != nil {
+		t.Fatalf("spool returned error: %s", err)
+	}
+
+	w.drain(func(batch []*influxdata.Point) error {
+		return errors.New("write failed")
+	})
+
+	if depth := w.depth(); depth != 2 {
+		t.Fatalf("depth() after a failed drain = %d, want 2 (nothing removed)", depth)
+	}
+}
+
+func TestWALEvictsOldestAtCapacity(t *testing.T) {
+	w, err := newWAL(t.TempDir())
+	if err != nil {
+		t.Fatalf("newWAL returned error: %s", err)
+	}
+	w.seq = maxWALFiles - 1
+
+	// One more batch than the WAL holds, so the last spool has to evict.
+	for i := 0; i <= maxWALFiles; i++ {
+		if err := w.spool([]*influxdata.Point{newTestPoint(t, "p")}); err != nil {
+			t.Fatalf("spool returned error: %s", err)
+		}
+	}
+
+	if depth := w.depth(); depth != maxWALFiles {
+		t.Fatalf("depth() = %d, want %d (capped, oldest evicted)", depth, maxWALFiles)
+	}
+	names, err := w.sortedFilesLocked()
+	if err != nil {
+		t.Fatalf("sortedFilesLocked returned error: %s", err)
+	}
+	if oldest := fmt.Sprintf("%020d.wal", maxWALFiles); names[0] == oldest {
+		t.Errorf("oldest spooled batch %s is still present, want it evicted", oldest)
+	}
+}
+
+func TestWALDisabledWithoutDir(t *testing.T) {
+	w, err := newWAL("")
+	if err != nil {
+		t.Fatalf("newWAL(\"\") returned error: %s", err)
+	}
+
+	if err := w.spool([]*influxdata.Point{newTestPoint(t, "a")}); err != nil {
+		t.Fatalf("spool on a disabled WAL returned error: %s", err)
+	}
+	if depth := w.depth(); depth != 0 {
+		t.Fatalf("depth() on a disabled WAL = %d, want 0", depth)
+	}
+}
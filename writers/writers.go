@@ -0,0 +1,45 @@
+// Package writers contains the broker-agnostic pipeline shared by the
+// various *-writer services (InfluxDB, ...). It subscribes to messages via
+// messaging.PubSub and persists them through a MessageRepository.
+package writers
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/go-kit/kit/metrics"
+	log "github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/mainflux/messaging"
+)
+
+// subject subscribes to every channel and subtopic.
+const subject = "channels.>"
+
+// MessageRepository specifies message writing API.
+type MessageRepository interface {
+	// Save persists the message to the underlying store.
+	Save(msg messaging.Message) error
+}
+
+// Start subscribes to subject on pubsub and persists every received message
+// using repo, instrumenting the writes with counter and latency.
+func Start(svcName string, pubsub messaging.PubSub, logger log.Logger, repo MessageRepository, counter metrics.Counter, latency metrics.Histogram) error {
+	handler := func(msg messaging.Message) error {
+		defer func(begin time.Time) {
+			latency.Observe(time.Since(begin).Seconds())
+			counter.Add(1)
+		}(time.Now())
+
+		if err := repo.Save(msg); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to save message: %s", err))
+			return err
+		}
+		return nil
+	}
+
+	if err := pubsub.Subscribe(subject, handler); err != nil {
+		return fmt.Errorf("failed to subscribe to subject %s: %s", subject, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,239 @@
+package api
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mainflux/mainflux/messaging"
+	"github.com/mainflux/mainflux/ws"
+)
+
+// CoAP method codes relevant to bridging a CoAP-over-WebSocket client onto
+// the adapter's internal publish/subscribe calls (RFC 7252, Section 12.1.2).
+const (
+	coapGET  = 0x01
+	coapPOST = 0x02
+
+	// coapContent is the 2.05 Content response code.
+	coapContent = 0x45
+	// coapOptionURIPath is the option number carrying a single Uri-Path
+	// segment (RFC 7252, Section 5.10).
+	coapOptionURIPath = 11
+)
+
+var errCoAPShortMessage = errors.New("coap: message too short")
+
+// serveCoAP bridges a CoAP-over-WebSocket connection (RFC 8323, Section
+// 8.2) onto svc. Every binary WS frame carries exactly one CoAP message;
+// its Uri-Path options are joined into a "channels/<id>/messages/<subtopic>"
+// topic, the same scheme used by the mqtt subprotocol. A GET subscribes to
+// the topic's subtopic; a POST publishes its payload to it.
+//
+// Unlike mqtt, authorization already ran against the plain HTTP request
+// before the connection was upgraded, so sub already carries the
+// authenticated publisher identity.
+func serveCoAP(svc ws.Service, sub subscription) {
+	defer sub.conn.Close()
+
+	chanIDStr := strconv.FormatUint(sub.chanID, 10)
+	subscribed := make(map[string]struct{})
+	defer func() {
+		for subtopic := range subscribed {
+			svc.Unsubscribe(chanIDStr, subtopic)
+		}
+	}()
+
+	for {
+		_, frame, err := sub.conn.ReadMessage()
+		if websocket.IsUnexpectedCloseError(err) {
+			return
+		}
+		if err != nil {
+			if isMessageTooLarge(err) {
+				msgsDropped.Inc()
+				closeWithCode(sub.conn, websocket.CloseMessageTooBig, "message too large")
+				return
+			}
+			logger.Warn(fmt.Sprintf("Failed to read coap message: %s", err))
+			return
+		}
+		if !sub.limiter.Allow() {
+			rateLimited.Inc()
+			closeWithCode(sub.conn, websocket.CloseTryAgainLater, "rate limit exceeded")
+			return
+		}
+
+		msg, err := decodeCoAPMessage(frame)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Failed to decode coap message: %s", err))
+			continue
+		}
+
+		subtopic, err := mqttSubtopic(sub.chanID, msg.topic)
+		if err != nil {
+			logger.Warn(fmt.Sprintf("Failed to handle coap message: %s", err))
+			continue
+		}
+
+		switch msg.code {
+		case coapPOST:
+			if err := handleCoAPPublish(svc, sub, subtopic, msg.payload); err != nil {
+				logger.Warn(fmt.Sprintf("Failed to publish coap message: %s", err))
+			}
+		case coapGET:
+			if err := handleCoAPSubscribe(svc, sub, subtopic, subscribed); err != nil {
+				logger.Warn(fmt.Sprintf("Failed to subscribe coap client: %s", err))
+				return
+			}
+		}
+	}
+}
+
+func handleCoAPPublish(svc ws.Service, sub subscription, subtopic string, payload []byte) error {
+	msg := messaging.Message{
+		Channel:     strconv.FormatUint(sub.chanID, 10),
+		Subtopic:    subtopic,
+		Publisher:   sub.pubID,
+		Protocol:    subprotoCoAP,
+		Payload:     payload,
+		ContentType: defContentType,
+		Created:     time.Now().UnixNano(),
+	}
+
+	if err := svc.Publish(msg); err != nil {
+		if err == ws.ErrFailedConnection {
+			sub.conn.Close()
+		}
+		return err
+	}
+
+	return nil
+}
+
+func handleCoAPSubscribe(svc ws.Service, sub subscription, subtopic string, subscribed map[string]struct{}) error {
+	if _, ok := subscribed[subtopic]; ok {
+		return nil
+	}
+
+	chanIDStr := strconv.FormatUint(sub.chanID, 10)
+	handler := func(msg messaging.Message) error {
+		if err := sub.conn.WriteMessage(websocket.BinaryMessage, encodeCoAPMessage(coapContent, msg.Payload)); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to broadcast coap message: %s", err))
+			return err
+		}
+		return nil
+	}
+	if err := svc.Subscribe(chanIDStr, subtopic, handler); err != nil {
+		return err
+	}
+	subscribed[subtopic] = struct{}{}
+
+	return nil
+}
+
+// coapMessage is the subset of a CoAP-over-WebSocket message the bridge
+// needs: the method code, the Uri-Path reassembled into a single
+// "/"-separated topic, and the payload.
+type coapMessage struct {
+	code    byte
+	topic   string
+	payload []byte
+}
+
+// decodeCoAPMessage decodes a single CoAP-over-WebSocket message (RFC 8323,
+// Section 8.2): a one-byte field whose high nibble is reserved (zero) and
+// whose low nibble is the token length, a one-byte code, the token, the
+// options, and an optional 0xFF-delimited payload.
+func decodeCoAPMessage(frame []byte) (coapMessage, error) {
+	if len(frame) < 2 {
+		return coapMessage{}, errCoAPShortMessage
+	}
+
+	tkl := int(frame[0] & 0x0f)
+	code := frame[1]
+	rest := frame[2:]
+	if len(rest) < tkl {
+		return coapMessage{}, errCoAPShortMessage
+	}
+	rest = rest[tkl:] // the token itself is not needed to route the message
+
+	segments, payload, err := decodeCoAPOptions(rest)
+	if err != nil {
+		return coapMessage{}, err
+	}
+
+	return coapMessage{code: code, topic: strings.Join(segments, "/"), payload: payload}, nil
+}
+
+// decodeCoAPOptions decodes the CoAP options block (RFC 7252, Section 3.1),
+// returning every Uri-Path segment in order and the payload that follows
+// the 0xFF marker, if any.
+func decodeCoAPOptions(b []byte) (segments []string, payload []byte, err error) {
+	optNum := 0
+
+	for len(b) > 0 {
+		if b[0] == 0xff {
+			return segments, b[1:], nil
+		}
+
+		delta := int(b[0] >> 4)
+		length := int(b[0] & 0x0f)
+		b = b[1:]
+
+		if delta, b, err = decodeCoAPExt(delta, b); err != nil {
+			return nil, nil, err
+		}
+		if length, b, err = decodeCoAPExt(length, b); err != nil {
+			return nil, nil, err
+		}
+		if len(b) < length {
+			return nil, nil, errCoAPShortMessage
+		}
+
+		optNum += delta
+		if optNum == coapOptionURIPath {
+			segments = append(segments, string(b[:length]))
+		}
+		b = b[length:]
+	}
+
+	return segments, nil, nil
+}
+
+// decodeCoAPExt resolves a CoAP option's 4-bit delta or length nibble into
+// its full value, consuming any extended-value bytes (RFC 7252, Section 3.1).
+func decodeCoAPExt(nibble int, b []byte) (int, []byte, error) {
+	switch nibble {
+	case 13:
+		if len(b) < 1 {
+			return 0, nil, errCoAPShortMessage
+		}
+		return int(b[0]) + 13, b[1:], nil
+	case 14:
+		if len(b) < 2 {
+			return 0, nil, errCoAPShortMessage
+		}
+		return int(binary.BigEndian.Uint16(b[:2])) + 269, b[2:], nil
+	case 15:
+		return 0, nil, errCoAPShortMessage
+	default:
+		return nibble, b, nil
+	}
+}
+
+// encodeCoAPMessage encodes a minimal CoAP-over-WebSocket message (RFC
+// 8323, Section 8.2) carrying payload, with the given response code, no
+// token, and no options. A non-empty payload follows the 0xFF marker.
+func encodeCoAPMessage(code byte, payload []byte) []byte {
+	msg := []byte{0x00, code}
+	if len(payload) == 0 {
+		return msg
+	}
+	msg = append(msg, 0xff)
+	return append(msg, payload...)
+}
@@ -0,0 +1,115 @@
+package api
+
+import (
+	"bytes"
+	"testing"
+)
+
+// encodeCoAPURIPathOption encodes a single option carrying segment with the
+// given delta from the previous option number (the Uri-Path number for the
+// first option, 0 for each repeated one), assuming both delta and length fit
+// in a nibble, which is all these tests need.
+func encodeCoAPURIPathOption(delta int, segment string) []byte {
+	return append([]byte{byte(delta<<4) | byte(len(segment))}, []byte(segment)...)
+}
+
+func TestDecodeCoAPOptions(t *testing.T) {
+	var b []byte
+	b = append(b, encodeCoAPURIPathOption(coapOptionURIPath, "channels")...)
+	b = append(b, encodeCoAPURIPathOption(0, "1")...)
+	b = append(b, encodeCoAPURIPathOption(0, "messages")...)
+	b = append(b, 0xff)
+	b = append(b, []byte("payload")...)
+
+	segments, payload, err := decodeCoAPOptions(b)
+	if err != nil {
+		t.Fatalf("decodeCoAPOptions returned error: %s", err)
+	}
+	want := []string{"channels", "1", "messages"}
+	if len(segments) != len(want) {
+		t.Fatalf("segments = %v, want %v", segments, want)
+	}
+	for i := range want {
+		if segments[i] != want[i] {
+			t.Errorf("segments[%d] = %q, want %q", i, segments[i], want[i])
+		}
+	}
+	if !bytes.Equal(payload, []byte("payload")) {
+		t.Errorf("payload = %q, want %q", payload, "payload")
+	}
+}
+
+func TestDecodeCoAPOptionsNoPayload(t *testing.T) {
+	b := encodeCoAPURIPathOption(coapOptionURIPath, "temp")
+
+	segments, payload, err := decodeCoAPOptions(b)
+	if err != nil {
+		t.Fatalf("decodeCoAPOptions returned error: %s", err)
+	}
+	if len(segments) != 1 || segments[0] != "temp" {
+		t.Errorf("segments = %v, want [temp]", segments)
+	}
+	if payload != nil {
+		t.Errorf("payload = %q, want nil", payload)
+	}
+}
+
+func TestDecodeCoAPExt(t *testing.T) {
+	cases := []struct {
+		name   string
+		nibble int
+		b      []byte
+		want   int
+	}{
+		{"inline value", 5, nil, 5},
+		{"1-byte extended", 13, []byte{10}, 23},
+		{"2-byte extended", 14, []byte{0x01, 0x00}, 256 + 269},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got, _, err := decodeCoAPExt(tc.nibble, tc.b)
+			if err != nil {
+				t.Fatalf("decodeCoAPExt(%d, %v) returned error: %s", tc.nibble, tc.b, err)
+			}
+			if got != tc.want {
+				t.Errorf("decodeCoAPExt(%d, %v) = %d, want %d", tc.nibble, tc.b, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestDecodeCoAPExtShortMessage(t *testing.T) {
+	if _, _, err := decodeCoAPExt(13, nil); err != errCoAPShortMessage {
+		t.Errorf("decodeCoAPExt(13, nil) returned %v, want errCoAPShortMessage", err)
+	}
+}
+
+func TestDecodeCoAPMessage(t *testing.T) {
+	frame := []byte{0x00, coapPOST} // no token
+	frame = append(frame, encodeCoAPURIPathOption(coapOptionURIPath, "channels")...)
+	frame = append(frame, encodeCoAPURIPathOption(0, "1")...)
+	frame = append(frame, encodeCoAPURIPathOption(0, "messages")...)
+	frame = append(frame, 0xff)
+	frame = append(frame, []byte("42")...)
+
+	msg, err := decodeCoAPMessage(frame)
+	if err != nil {
+		t.Fatalf("decodeCoAPMessage returned error: %s", err)
+	}
+	if msg.code != coapPOST {
+		t.Errorf("code = %#x, want %#x", msg.code, coapPOST)
+	}
+	if msg.topic != "channels/1/messages" {
+		t.Errorf("topic = %q, want %q", msg.topic, "channels/1/messages")
+	}
+	if !bytes.Equal(msg.payload, []byte("42")) {
+		t.Errorf("payload = %q, want %q", msg.payload, "42")
+	}
+}
+
+func TestDecodeCoAPMessageShort(t *testing.T) {
+	if _, err := decodeCoAPMessage([]byte{0x00}); err != errCoAPShortMessage {
+		t.Errorf("decodeCoAPMessage on a short frame returned %v, want errCoAPShortMessage", err)
+	}
+}
@@ -0,0 +1,169 @@
+package api
+
+import (
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// jwksCacheTTL bounds how long fetched JWKS keys are trusted before a
+// lookup forces a refresh, so a rotated signing key is picked up without
+// restarting the adapter.
+const jwksCacheTTL = 5 * time.Minute
+
+// jwksFetchTimeout bounds how long a JWKS refresh waits on the endpoint,
+// so a slow or hung endpoint fails the handshake into errUnauthorizedJWT
+// instead of blocking it indefinitely.
+const jwksFetchTimeout = 5 * time.Second
+
+// jwksClient fetches and caches the RSA public keys published at a JWKS
+// endpoint, keyed by "kid".
+type jwksClient struct {
+	url    string
+	client *http.Client
+
+	mu        sync.Mutex
+	keys      map[string]*rsa.PublicKey
+	fetchedAt time.Time
+}
+
+func newJWKSClient(url string) *jwksClient {
+	return &jwksClient{
+		url:    url,
+		client: &http.Client{Timeout: jwksFetchTimeout},
+		keys:   map[string]*rsa.PublicKey{},
+	}
+}
+
+// keyFunc is a jwt.Keyfunc that resolves a token's "kid" header against the
+// cached JWKS, refreshing the cache first on a miss or once the cache has
+// gone stale.
+func (c *jwksClient) keyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, fmt.Errorf("unexpected jwt signing method: %v", token.Header["alg"])
+	}
+	kid, _ := token.Header["kid"].(string)
+
+	c.mu.Lock()
+	key, ok := c.keys[kid]
+	stale := time.Since(c.fetchedAt) > jwksCacheTTL
+	c.mu.Unlock()
+
+	if ok && !stale {
+		return key, nil
+	}
+
+	if err := c.refresh(); err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	key, ok = c.keys[kid]
+	c.mu.Unlock()
+	if !ok {
+		return nil, fmt.Errorf("unknown jwt signing key %q", kid)
+	}
+
+	return key, nil
+}
+
+// jwk is the subset of RFC 7517 fields needed to build an RSA public key.
+type jwk struct {
+	Kid string `json:"kid"`
+	Kty string `json:"kty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jwksDoc struct {
+	Keys []jwk `json:"keys"`
+}
+
+// refresh fetches the JWKS document and replaces the key cache wholesale,
+// so a key removed by rotation stops being trusted.
+func (c *jwksClient) refresh() error {
+	resp, err := c.client.Get(c.url)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	var doc jwksDoc
+	if err := json.NewDecoder(resp.Body).Decode(&doc); err != nil {
+		return err
+	}
+
+	keys := make(map[string]*rsa.PublicKey, len(doc.Keys))
+	for _, k := range doc.Keys {
+		if k.Kty != "RSA" {
+			continue
+		}
+		pub, err := k.rsaPublicKey()
+		if err != nil {
+			continue
+		}
+		keys[k.Kid] = pub
+	}
+
+	c.mu.Lock()
+	c.keys = keys
+	c.fetchedAt = time.Now()
+	c.mu.Unlock()
+
+	return nil
+}
+
+// rsaPublicKey decodes a JWK's modulus and exponent into an *rsa.PublicKey
+// (RFC 7518, Section 6.3.1).
+func (k jwk) rsaPublicKey() (*rsa.PublicKey, error) {
+	nb, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	eb, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+
+	return &rsa.PublicKey{
+		N: new(big.Int).SetBytes(nb),
+		E: int(new(big.Int).SetBytes(eb).Int64()),
+	}, nil
+}
+
+// subFromJWT validates tokenString against c's cached JWKS and returns its
+// "sub" claim.
+func subFromJWT(c *jwksClient, tokenString string) (string, error) {
+	token, err := jwt.Parse(tokenString, c.keyFunc)
+	if err != nil {
+		return "", err
+	}
+	if !token.Valid {
+		return "", fmt.Errorf("invalid jwt")
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", fmt.Errorf("invalid jwt claims")
+	}
+	sub, ok := claims["sub"].(string)
+	if !ok || sub == "" {
+		return "", fmt.Errorf("jwt missing sub claim")
+	}
+
+	return sub, nil
+}
+
+// looksLikeJWT reports whether s has the three dot-separated segments of a
+// compact JWT, without verifying anything about it.
+func looksLikeJWT(s string) bool {
+	return strings.Count(s, ".") == 2
+}
@@ -0,0 +1,157 @@
+package api
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	jwt "github.com/dgrijalva/jwt-go"
+)
+
+// newTestJWKSServer serves a JWKS document built from the given RSA public
+// keys, keyed by kid.
+func newTestJWKSServer(t *testing.T, keys map[string]*rsa.PublicKey) *httptest.Server {
+	t.Helper()
+
+	doc := jwksDoc{}
+	for kid, pub := range keys {
+		doc.Keys = append(doc.Keys, jwk{
+			Kid: kid,
+			Kty: "RSA",
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		})
+	}
+
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(doc)
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func signRSAToken(t *testing.T, key *rsa.PrivateKey, kid string, claims jwt.MapClaims) string {
+	t.Helper()
+
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("failed to sign test token: %s", err)
+	}
+	return signed
+}
+
+func TestSubFromJWT(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate test key: %s", err)
+	}
+
+	srv := newTestJWKSServer(t, map[string]*rsa.PublicKey{"kid1": &key.PublicKey})
+	c := newJWKSClient(srv.URL)
+
+	t.Run("correct kid resolves", func(t *testing.T) {
+		token := signRSAToken(t, key, "kid1", jwt.MapClaims{"sub": "user-1"})
+
+		sub, err := subFromJWT(c, token)
+		if err != nil {
+			t.Fatalf("subFromJWT returned error: %s", err)
+		}
+		if sub != "user-1" {
+			t.Errorf("sub = %q, want %q", sub, "user-1")
+		}
+	})
+
+	t.Run("non-RSA alg is rejected", func(t *testing.T) {
+		token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{"sub": "user-1"})
+		signed, err := token.SignedString([]byte("secret"))
+		if err != nil {
+			t.Fatalf("failed to sign HS256 token: %s", err)
+		}
+
+		if _, err := subFromJWT(c, signed); err == nil {
+			t.Error("subFromJWT accepted an HS256 token, want it rejected")
+		}
+	})
+
+	t.Run("missing sub is rejected", func(t *testing.T) {
+		token := signRSAToken(t, key, "kid1", jwt.MapClaims{})
+
+		if _, err := subFromJWT(c, token); err == nil {
+			t.Error("subFromJWT accepted a token with no sub claim, want it rejected")
+		}
+	})
+
+	t.Run("empty sub is rejected", func(t *testing.T) {
+		token := signRSAToken(t, key, "kid1", jwt.MapClaims{"sub": ""})
+
+		if _, err := subFromJWT(c, token); err == nil {
+			t.Error("subFromJWT accepted a token with an empty sub claim, want it rejected")
+		}
+	})
+
+	t.Run("unknown kid is rejected", func(t *testing.T) {
+		token := signRSAToken(t, key, "no-such-kid", jwt.MapClaims{"sub": "user-1"})
+
+		if _, err := subFromJWT(c, token); err == nil {
+			t.Error("subFromJWT accepted a token with an unknown kid, want it rejected")
+		}
+	})
+}
+
+func TestSubFromJWTRefreshesStaleCache(t *testing.T) {
+	oldKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate old test key: %s", err)
+	}
+	newKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("failed to generate new test key: %s", err)
+	}
+
+	srv := newTestJWKSServer(t, map[string]*rsa.PublicKey{"kid1": &newKey.PublicKey})
+	c := newJWKSClient(srv.URL)
+
+	// Prime the cache with a stale entry for "kid1" pointing at a public key
+	// the server no longer serves, simulating a rotation that happened
+	// after the last successful fetch.
+	c.keys["kid1"] = &oldKey.PublicKey
+	c.fetchedAt = time.Now().Add(-2 * jwksCacheTTL)
+
+	token := signRSAToken(t, newKey, "kid1", jwt.MapClaims{"sub": "user-1"})
+
+	sub, err := subFromJWT(c, token)
+	if err != nil {
+		t.Fatalf("subFromJWT returned error after key rotation: %s", err)
+	}
+	if sub != "user-1" {
+		t.Errorf("sub = %q, want %q", sub, "user-1")
+	}
+}
+
+func TestLooksLikeJWT(t *testing.T) {
+	cases := []struct {
+		s    string
+		want bool
+	}{
+		{"a.b.c", true},
+		{"header.payload.signature", true},
+		{"not-a-jwt", false},
+		{"", false},
+		{"a.b", false},
+		{"a.b.c.d", false},
+	}
+
+	for _, tc := range cases {
+		if got := looksLikeJWT(tc.s); got != tc.want {
+			t.Errorf("looksLikeJWT(%q) = %v, want %v", tc.s, got, tc.want)
+		}
+	}
+}
@@ -0,0 +1,386 @@
+package api
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/websocket"
+	"github.com/mainflux/mainflux"
+	"github.com/mainflux/mainflux/messaging"
+	"github.com/mainflux/mainflux/ws"
+)
+
+// MQTT control packet types, restricted to the subset needed to bridge an
+// MQTT-over-WebSocket client onto the adapter's internal publish/subscribe
+// calls (MQTT v3.1.1, Section 2.2.1).
+const (
+	mqttConnect   = 1
+	mqttConnack   = 2
+	mqttPublish   = 3
+	mqttSuback    = 9
+	mqttSubscribe = 8
+
+	mqttConnackAccepted     = 0
+	mqttConnackNotAuthorize = 5
+)
+
+var (
+	errMQTTShortPacket = errors.New("mqtt: packet too short")
+	errMQTTBadTopic    = errors.New("mqtt: topic is not scoped to this channel")
+)
+
+// serveMQTT bridges an MQTT-over-WebSocket connection, as used by browser
+// libraries such as paho.mqtt.js, onto svc. Every subprotocol-agnostic WS
+// binary frame is expected to carry exactly one MQTT control packet, which
+// is how MQTT.js and other browser clients frame their traffic.
+//
+// Authentication is deferred to the CONNECT packet: its username is
+// ignored and its password is used as the Mainflux auth token, checked
+// against sub.chanID via the Things gRPC service. Every subsequent PUBLISH
+// or SUBSCRIBE topic must be of the form "channels/<id>/messages/<subtopic>"
+// for the channel id carried in the connection's URL.
+func serveMQTT(svc ws.Service, sub subscription) {
+	defer sub.conn.Close()
+
+	packetType, _, body, err := readMQTTPacket(sub.conn)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Failed to read mqtt CONNECT: %s", err))
+		return
+	}
+	if packetType != mqttConnect {
+		logger.Warn("Expected mqtt CONNECT as the first packet")
+		return
+	}
+
+	pkt, err := decodeMQTTConnect(body)
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Failed to decode mqtt CONNECT: %s", err))
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	id, err := auth.CanAccess(ctx, &mainflux.AccessReq{Token: pkt.password, ChanID: sub.chanID})
+	cancel()
+	if err != nil {
+		logger.Warn(fmt.Sprintf("Failed to authorize mqtt client: %s", err))
+		sub.conn.WriteMessage(websocket.BinaryMessage, encodeMQTTConnack(mqttConnackNotAuthorize))
+		return
+	}
+	sub.pubID = strconv.FormatUint(id.GetValue(), 10)
+
+	if err := sub.conn.WriteMessage(websocket.BinaryMessage, encodeMQTTConnack(mqttConnackAccepted)); err != nil {
+		return
+	}
+
+	chanIDStr := strconv.FormatUint(sub.chanID, 10)
+	subscribed := make(map[string]struct{})
+	defer func() {
+		for subtopic := range subscribed {
+			svc.Unsubscribe(chanIDStr, subtopic)
+		}
+	}()
+
+	for {
+		packetType, flags, body, err := readMQTTPacket(sub.conn)
+		if websocket.IsUnexpectedCloseError(err) {
+			return
+		}
+		if err != nil {
+			if isMessageTooLarge(err) {
+				msgsDropped.Inc()
+				closeWithCode(sub.conn, websocket.CloseMessageTooBig, "message too large")
+				return
+			}
+			logger.Warn(fmt.Sprintf("Failed to read mqtt packet: %s", err))
+			return
+		}
+		if !sub.limiter.Allow() {
+			rateLimited.Inc()
+			closeWithCode(sub.conn, websocket.CloseTryAgainLater, "rate limit exceeded")
+			return
+		}
+
+		switch packetType {
+		case mqttPublish:
+			if err := handleMQTTPublish(svc, sub, flags, body); err != nil {
+				logger.Warn(fmt.Sprintf("Failed to publish mqtt message: %s", err))
+			}
+		case mqttSubscribe:
+			if err := handleMQTTSubscribe(svc, sub, body, subscribed); err != nil {
+				logger.Warn(fmt.Sprintf("Failed to subscribe mqtt client: %s", err))
+				return
+			}
+		}
+	}
+}
+
+func handleMQTTPublish(svc ws.Service, sub subscription, flags byte, body []byte) error {
+	pub, err := decodeMQTTPublish(flags, body)
+	if err != nil {
+		return err
+	}
+
+	subtopic, err := mqttSubtopic(sub.chanID, pub.topic)
+	if err != nil {
+		return err
+	}
+
+	msg := messaging.Message{
+		Channel:     strconv.FormatUint(sub.chanID, 10),
+		Subtopic:    subtopic,
+		Publisher:   sub.pubID,
+		Protocol:    subprotoMQTT,
+		Payload:     pub.payload,
+		ContentType: defContentType,
+		Created:     time.Now().UnixNano(),
+	}
+
+	if err := svc.Publish(msg); err != nil {
+		if err == ws.ErrFailedConnection {
+			sub.conn.Close()
+		}
+		return err
+	}
+
+	return nil
+}
+
+func handleMQTTSubscribe(svc ws.Service, sub subscription, body []byte, subscribed map[string]struct{}) error {
+	packetID, topics, err := decodeMQTTSubscribe(body)
+	if err != nil {
+		return err
+	}
+
+	chanIDStr := strconv.FormatUint(sub.chanID, 10)
+	for _, topic := range topics {
+		subtopic, err := mqttSubtopic(sub.chanID, topic)
+		if err != nil {
+			return err
+		}
+
+		handler := func(msg messaging.Message) error {
+			if err := sub.conn.WriteMessage(websocket.BinaryMessage, encodeMQTTPublish(topic, msg.Payload)); err != nil {
+				logger.Warn(fmt.Sprintf("Failed to broadcast mqtt message: %s", err))
+				return err
+			}
+			return nil
+		}
+		if err := svc.Subscribe(chanIDStr, subtopic, handler); err != nil {
+			return err
+		}
+		subscribed[subtopic] = struct{}{}
+	}
+
+	return sub.conn.WriteMessage(websocket.BinaryMessage, encodeMQTTSuback(packetID, len(topics)))
+}
+
+// mqttSubtopic validates that topic is scoped to chanID, in the
+// "channels/<id>/messages[/<subtopic>]" form, and returns its subtopic.
+func mqttSubtopic(chanID uint64, topic string) (string, error) {
+	prefix := fmt.Sprintf("channels/%d/messages", chanID)
+	if topic == prefix {
+		return "", nil
+	}
+	if !strings.HasPrefix(topic, prefix+"/") {
+		return "", errMQTTBadTopic
+	}
+	return strings.TrimPrefix(topic, prefix+"/"), nil
+}
+
+type mqttConnectPacket struct {
+	username string
+	password string
+}
+
+type mqttPublishPacket struct {
+	topic   string
+	payload []byte
+}
+
+// readMQTTPacket reads the single MQTT control packet carried by the next
+// WebSocket binary frame.
+func readMQTTPacket(conn *websocket.Conn) (packetType, flags byte, body []byte, err error) {
+	_, frame, err := conn.ReadMessage()
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	return decodeMQTTPacket(frame)
+}
+
+// decodeMQTTPacket splits frame into its MQTT fixed header fields and
+// remaining-length-bounded body.
+func decodeMQTTPacket(frame []byte) (packetType, flags byte, body []byte, err error) {
+	if len(frame) < 2 {
+		return 0, 0, nil, errMQTTShortPacket
+	}
+
+	packetType = frame[0] >> 4
+	flags = frame[0] & 0x0f
+
+	length, n, err := decodeMQTTLength(frame[1:])
+	if err != nil {
+		return 0, 0, nil, err
+	}
+
+	rest := frame[1+n:]
+	if len(rest) < length {
+		return 0, 0, nil, errMQTTShortPacket
+	}
+
+	return packetType, flags, rest[:length], nil
+}
+
+// decodeMQTTLength decodes the variable-length "Remaining Length" field
+// used throughout the MQTT fixed header (Section 2.2.3).
+func decodeMQTTLength(b []byte) (length, consumed int, err error) {
+	multiplier := 1
+	for i := 0; i < len(b) && i < 4; i++ {
+		length += int(b[i]&0x7f) * multiplier
+		consumed++
+		if b[i]&0x80 == 0 {
+			return length, consumed, nil
+		}
+		multiplier *= 128
+	}
+	return 0, 0, errMQTTShortPacket
+}
+
+func encodeMQTTLength(length int) []byte {
+	var b []byte
+	for {
+		d := byte(length % 128)
+		length /= 128
+		if length > 0 {
+			d |= 0x80
+		}
+		b = append(b, d)
+		if length == 0 {
+			return b
+		}
+	}
+}
+
+func readMQTTString(b []byte) (string, []byte, error) {
+	if len(b) < 2 {
+		return "", nil, errMQTTShortPacket
+	}
+	n := int(binary.BigEndian.Uint16(b[:2]))
+	if len(b) < 2+n {
+		return "", nil, errMQTTShortPacket
+	}
+	return string(b[2 : 2+n]), b[2+n:], nil
+}
+
+func encodeMQTTString(s string) []byte {
+	b := make([]byte, 2+len(s))
+	binary.BigEndian.PutUint16(b, uint16(len(s)))
+	copy(b[2:], s)
+	return b
+}
+
+// decodeMQTTConnect decodes a CONNECT packet body (Section 3.1), returning
+// its username and password when present.
+func decodeMQTTConnect(body []byte) (mqttConnectPacket, error) {
+	_, rest, err := readMQTTString(body) // protocol name
+	if err != nil {
+		return mqttConnectPacket{}, err
+	}
+	if len(rest) < 4 {
+		return mqttConnectPacket{}, errMQTTShortPacket
+	}
+	flags := rest[1]
+	rest = rest[4:] // protocol level (1) + connect flags (1) + keep alive (2)
+
+	_, rest, err = readMQTTString(rest) // client id
+	if err != nil {
+		return mqttConnectPacket{}, err
+	}
+
+	if flags&0x04 != 0 { // will flag: will topic, will message
+		if _, rest, err = readMQTTString(rest); err != nil {
+			return mqttConnectPacket{}, err
+		}
+		if _, rest, err = readMQTTString(rest); err != nil {
+			return mqttConnectPacket{}, err
+		}
+	}
+
+	var pkt mqttConnectPacket
+	if flags&0x80 != 0 {
+		if pkt.username, rest, err = readMQTTString(rest); err != nil {
+			return mqttConnectPacket{}, err
+		}
+	}
+	if flags&0x40 != 0 {
+		if pkt.password, _, err = readMQTTString(rest); err != nil {
+			return mqttConnectPacket{}, err
+		}
+	}
+
+	return pkt, nil
+}
+
+// decodeMQTTPublish decodes a PUBLISH packet body (Section 3.3), skipping
+// the packet identifier carried by QoS 1 and 2 messages.
+func decodeMQTTPublish(flags byte, body []byte) (mqttPublishPacket, error) {
+	topic, rest, err := readMQTTString(body)
+	if err != nil {
+		return mqttPublishPacket{}, err
+	}
+
+	if qos := (flags >> 1) & 0x03; qos > 0 {
+		if len(rest) < 2 {
+			return mqttPublishPacket{}, errMQTTShortPacket
+		}
+		rest = rest[2:]
+	}
+
+	return mqttPublishPacket{topic: topic, payload: rest}, nil
+}
+
+// decodeMQTTSubscribe decodes a SUBSCRIBE packet body (Section 3.8),
+// returning its packet identifier and every requested topic filter.
+func decodeMQTTSubscribe(body []byte) (packetID uint16, topics []string, err error) {
+	if len(body) < 2 {
+		return 0, nil, errMQTTShortPacket
+	}
+	packetID = binary.BigEndian.Uint16(body[:2])
+	body = body[2:]
+
+	for len(body) > 0 {
+		topic, rest, err := readMQTTString(body)
+		if err != nil {
+			return 0, nil, err
+		}
+		if len(rest) < 1 {
+			return 0, nil, errMQTTShortPacket
+		}
+		topics = append(topics, topic)
+		body = rest[1:] // requested QoS
+	}
+
+	return packetID, topics, nil
+}
+
+func encodeMQTTConnack(returnCode byte) []byte {
+	body := []byte{0, returnCode}
+	return append([]byte{mqttConnack << 4}, append(encodeMQTTLength(len(body)), body...)...)
+}
+
+func encodeMQTTSuback(packetID uint16, count int) []byte {
+	body := make([]byte, 2+count)
+	binary.BigEndian.PutUint16(body, packetID)
+	header := append([]byte{mqttSuback << 4}, encodeMQTTLength(len(body))...)
+	return append(header, body...)
+}
+
+func encodeMQTTPublish(topic string, payload []byte) []byte {
+	body := append(encodeMQTTString(topic), payload...)
+	header := append([]byte{mqttPublish << 4}, encodeMQTTLength(len(body))...)
+	return append(header, body...)
+}
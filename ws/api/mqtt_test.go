@@ -0,0 +1,119 @@
+package api
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMQTTLengthRoundTrip(t *testing.T) {
+	cases := []int{0, 1, 127, 128, 16383, 16384, 2097151}
+
+	for _, length := range cases {
+		encoded := encodeMQTTLength(length)
+		decoded, consumed, err := decodeMQTTLength(encoded)
+		if err != nil {
+			t.Fatalf("decodeMQTTLength(%v) returned error: %s", encoded, err)
+		}
+		if decoded != length {
+			t.Errorf("decodeMQTTLength(encodeMQTTLength(%d)) = %d", length, decoded)
+		}
+		if consumed != len(encoded) {
+			t.Errorf("decodeMQTTLength consumed %d bytes, encodeMQTTLength produced %d", consumed, len(encoded))
+		}
+	}
+}
+
+func TestDecodeMQTTConnect(t *testing.T) {
+	var body []byte
+	body = append(body, encodeMQTTString("MQTT")...)
+	body = append(body, 4, 0xc0, 0, 60) // protocol level, flags (user+pass), keep alive
+	body = append(body, encodeMQTTString("client-id")...)
+	body = append(body, encodeMQTTString("user")...)
+	body = append(body, encodeMQTTString("token")...)
+
+	pkt, err := decodeMQTTConnect(body)
+	if err != nil {
+		t.Fatalf("decodeMQTTConnect returned error: %s", err)
+	}
+	if pkt.username != "user" {
+		t.Errorf("username = %q, want %q", pkt.username, "user")
+	}
+	if pkt.password != "token" {
+		t.Errorf("password = %q, want %q", pkt.password, "token")
+	}
+}
+
+func TestDecodeMQTTConnectShortPacket(t *testing.T) {
+	if _, err := decodeMQTTConnect([]byte{0, 1}); err != errMQTTShortPacket {
+		t.Errorf("decodeMQTTConnect on a short packet returned %v, want errMQTTShortPacket", err)
+	}
+}
+
+func TestDecodeMQTTPublish(t *testing.T) {
+	var body []byte
+	body = append(body, encodeMQTTString("channels/1/messages/temp")...)
+	body = append(body, []byte("payload")...)
+
+	pub, err := decodeMQTTPublish(0, body)
+	if err != nil {
+		t.Fatalf("decodeMQTTPublish returned error: %s", err)
+	}
+	if pub.topic != "channels/1/messages/temp" {
+		t.Errorf("topic = %q", pub.topic)
+	}
+	if !bytes.Equal(pub.payload, []byte("payload")) {
+		t.Errorf("payload = %q, want %q", pub.payload, "payload")
+	}
+}
+
+func TestDecodeMQTTSubscribe(t *testing.T) {
+	var body []byte
+	body = append(body, 0, 7) // packet identifier
+	body = append(body, encodeMQTTString("channels/1/messages")...)
+	body = append(body, 0) // requested QoS
+	body = append(body, encodeMQTTString("channels/1/messages/temp")...)
+	body = append(body, 0)
+
+	packetID, topics, err := decodeMQTTSubscribe(body)
+	if err != nil {
+		t.Fatalf("decodeMQTTSubscribe returned error: %s", err)
+	}
+	if packetID != 7 {
+		t.Errorf("packetID = %d, want 7", packetID)
+	}
+	want := []string{"channels/1/messages", "channels/1/messages/temp"}
+	if len(topics) != len(want) || topics[0] != want[0] || topics[1] != want[1] {
+		t.Errorf("topics = %v, want %v", topics, want)
+	}
+}
+
+func TestMQTTSubtopic(t *testing.T) {
+	cases := []struct {
+		topic   string
+		want    string
+		wantErr bool
+	}{
+		{"channels/1/messages", "", false},
+		{"channels/1/messages/temp", "temp", false},
+		{"channels/1/messages/temp/in", "temp/in", false},
+		{"channels/2/messages/temp", "", true},
+		{"garbage", "", true},
+	}
+
+	for _, tc := range cases {
+		got, err := mqttSubtopic(1, tc.topic)
+		if tc.wantErr {
+			if err == nil {
+				t.Errorf("mqttSubtopic(1, %q) returned no error, want one", tc.topic)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("mqttSubtopic(1, %q) returned error: %s", tc.topic, err)
+			continue
+		}
+		if got != tc.want {
+			t.Errorf("mqttSubtopic(1, %q) = %q, want %q", tc.topic, got, tc.want)
+		}
+	}
+}
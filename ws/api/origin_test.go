@@ -0,0 +1,25 @@
+package api
+
+import "testing"
+
+func TestMatchesOrigin(t *testing.T) {
+	cases := []struct {
+		pattern string
+		host    string
+		want    bool
+	}{
+		{"example.com", "example.com", true},
+		{"example.com", "evil.com", false},
+		{"example.com", "sub.example.com", false},
+		{"*.example.com", "sub.example.com", true},
+		{"*.example.com", "a.b.example.com", true},
+		{"*.example.com", "example.com", false},
+		{"*.example.com", "evil.com", false},
+	}
+
+	for _, tc := range cases {
+		if got := matchesOrigin(tc.pattern, tc.host); got != tc.want {
+			t.Errorf("matchesOrigin(%q, %q) = %v, want %v", tc.pattern, tc.host, got, tc.want)
+		}
+	}
+}
@@ -5,42 +5,90 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-zoo/bone"
 	"github.com/gorilla/websocket"
 	"github.com/mainflux/mainflux"
 	log "github.com/mainflux/mainflux/logger"
+	"github.com/mainflux/mainflux/messaging"
 	"github.com/mainflux/mainflux/things"
 	"github.com/mainflux/mainflux/ws"
+	stdprometheus "github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"golang.org/x/time/rate"
 	"google.golang.org/grpc/codes"
 	"google.golang.org/grpc/status"
 )
 
-const protocol = "ws"
+const (
+	protocol       = "ws"
+	defContentType = "application/octet-stream"
+
+	// Subprotocols negotiated over Sec-WebSocket-Protocol, in addition to
+	// the default raw text-frame protocol used when none is requested.
+	subprotoMQTT    = "mqtt"
+	subprotoMQTTv31 = "mqttv3.1"
+	subprotoCoAP    = "coap"
+)
 
 var (
 	errUnauthorizedAccess = errors.New("missing or invalid credentials provided")
 	errNotFound           = errors.New("non-existent entity")
+	errUnauthorizedJWT    = errors.New("invalid or expired jwt")
 	upgrader              = websocket.Upgrader{
 		ReadBufferSize:  1024,
 		WriteBufferSize: 1024,
-		CheckOrigin: func(r *http.Request) bool {
-			return true
-		},
+		Subprotocols:    []string{subprotoMQTT, subprotoMQTTv31, subprotoCoAP},
+		CheckOrigin:     originAllowed,
 	}
-	auth   mainflux.ThingsServiceClient
-	logger log.Logger
+	auth           mainflux.ThingsServiceClient
+	logger         log.Logger
+	maxMsgSize     int64
+	readRate       rate.Limit
+	readBurst      int
+	allowedOrigins []string
+	jwks           *jwksClient
+
+	msgsDropped = promauto.NewCounter(stdprometheus.CounterOpts{
+		Namespace: "ws",
+		Subsystem: "message_writer",
+		Name:      "messages_dropped_total",
+		Help:      "Total number of inbound messages dropped for exceeding the size limit.",
+	})
+	rateLimited = promauto.NewCounter(stdprometheus.CounterOpts{
+		Namespace: "ws",
+		Subsystem: "message_writer",
+		Name:      "rate_limited_total",
+		Help:      "Total number of connections closed for exceeding the read rate limit.",
+	})
 )
 
-// MakeHandler returns http handler with handshake endpoint.
-func MakeHandler(svc ws.Service, cc mainflux.ThingsServiceClient, l log.Logger) http.Handler {
+// MakeHandler returns http handler with handshake endpoint. maxSize bounds
+// the size, in bytes, of an inbound WebSocket message; rps and burst
+// configure the per-connection token-bucket read rate limiter. origins
+// lists the allowed WebSocket origins, supporting "*.example.com"
+// wildcards; a request without an Origin header (as sent by non-browser
+// clients) is always allowed. jwksURL, if non-empty, enables validating
+// Authorization values that look like a JWT against that JWKS endpoint.
+func MakeHandler(svc ws.Service, cc mainflux.ThingsServiceClient, l log.Logger, maxSize int64, rps float64, burst int, origins []string, jwksURL string) http.Handler {
 	auth = cc
 	logger = l
+	maxMsgSize = maxSize
+	readRate = rate.Limit(rps)
+	readBurst = burst
+	allowedOrigins = origins
+	if jwksURL != "" {
+		jwks = newJWKSClient(jwksURL)
+	}
 
 	mux := bone.New()
 	mux.GetFunc("/channels/:id/messages", handshake(svc))
+	mux.GetFunc("/channels/:id/messages/*subtopic", handshake(svc))
 	mux.GetFunc("/version", mainflux.Version("websocket"))
 	mux.Handle("/metrics", promhttp.Handler())
 
@@ -49,18 +97,30 @@ func MakeHandler(svc ws.Service, cc mainflux.ThingsServiceClient, l log.Logger)
 
 func handshake(svc ws.Service) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
-		sub, err := authorize(r)
-		if err == errNotFound {
-			logger.Warn(fmt.Sprintf("Invalid channel id: %s", err))
-			w.WriteHeader(http.StatusNotFound)
-			return
-		}
-		if err != nil {
+		// mqtt and mqttv3.1 authenticate from the CONNECT packet sent once
+		// the connection is upgraded, so the channel id is all that is
+		// needed up front; every other subprotocol authorizes the same way
+		// raw connections always have, against the plain HTTP request.
+		var sub subscription
+		var err error
+		if isMQTTRequested(r) {
+			sub.chanID, err = things.FromString(bone.GetValue(r, "id"))
+			if err != nil {
+				logger.Warn(fmt.Sprintf("Invalid channel id: %s", err))
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+		} else if sub, err = authorize(r); err != nil {
 			switch err {
 			case errNotFound:
 				logger.Warn(fmt.Sprintf("Invalid channel id: %s", err))
 				w.WriteHeader(http.StatusNotFound)
 				return
+			case errUnauthorizedJWT:
+				logger.Warn(fmt.Sprintf("Failed to authorize: %s", err))
+				w.Header().Set("WWW-Authenticate", "Bearer")
+				w.WriteHeader(http.StatusUnauthorized)
+				return
 			default:
 				logger.Warn(fmt.Sprintf("Failed to authorize: %s", err))
 				e, ok := status.FromError(err)
@@ -84,23 +144,84 @@ func handshake(svc ws.Service) http.HandlerFunc {
 			logger.Warn(fmt.Sprintf("Failed to upgrade connection to websocket: %s", err))
 			return
 		}
+		conn.SetReadLimit(maxMsgSize)
 		sub.conn = conn
+		sub.limiter = rate.NewLimiter(readRate, readBurst)
 
-		// Subscribe to channel
-		channel := ws.Channel{make(chan mainflux.RawMessage), make(chan bool)}
-		sub.channel = channel
-		if err := svc.Subscribe(sub.chanID, sub.channel); err != nil {
-			logger.Warn(fmt.Sprintf("Failed to subscribe to NATS subject: %s", err))
+		switch conn.Subprotocol() {
+		case subprotoMQTT, subprotoMQTTv31:
+			go serveMQTT(svc, sub)
+			return
+		case subprotoCoAP:
+			go serveCoAP(svc, sub)
+			return
+		}
+
+		// Subscribe to the channel subtree rooted at subtopic; handler
+		// forwards broker messages to the client regardless of which
+		// backend the subscription runs on.
+		handler := func(msg messaging.Message) error {
+			if err := sub.conn.WriteMessage(websocket.TextMessage, msg.Payload); err != nil {
+				logger.Warn(fmt.Sprintf("Failed to broadcast message to thing: %s", err))
+				return err
+			}
+			return nil
+		}
+		if err := svc.Subscribe(strconv.FormatUint(sub.chanID, 10), sub.subtopic, handler); err != nil {
+			logger.Warn(fmt.Sprintf("Failed to subscribe to channel: %s", err))
 			conn.Close()
 			return
 		}
-		go sub.listen()
 
-		// Start listening for messages from NATS.
+		// Start listening for messages from the client.
 		go sub.broadcast(svc)
 	}
 }
 
+// isMQTTRequested reports whether the client asked to negotiate the mqtt or
+// mqttv3.1 subprotocol.
+func isMQTTRequested(r *http.Request) bool {
+	for _, p := range websocket.Subprotocols(r) {
+		if p == subprotoMQTT || p == subprotoMQTTv31 {
+			return true
+		}
+	}
+	return false
+}
+
+// originAllowed is the upgrader's CheckOrigin: a request without an Origin
+// header is not a browser request and is always allowed; otherwise the
+// origin's host must match one of allowedOrigins.
+func originAllowed(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+
+	u, err := url.Parse(origin)
+	if err != nil {
+		return false
+	}
+
+	for _, pattern := range allowedOrigins {
+		if matchesOrigin(pattern, u.Host) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesOrigin reports whether host satisfies pattern, which is either an
+// exact host or a "*.example.com" wildcard matching any subdomain of
+// example.com.
+func matchesOrigin(pattern, host string) bool {
+	if suffix := strings.TrimPrefix(pattern, "*"); suffix != pattern {
+		return strings.HasSuffix(host, suffix)
+	}
+	return pattern == host
+}
+
 func authorize(r *http.Request) (subscription, error) {
 	authKey := r.Header.Get("Authorization")
 	if authKey == "" {
@@ -110,6 +231,7 @@ func authorize(r *http.Request) (subscription, error) {
 		}
 		authKey = authKeys[0]
 	}
+	authKey = strings.TrimPrefix(authKey, "Bearer ")
 
 	// Extract ID from /channels/:id/messages.
 	chanID, err := things.FromString(bone.GetValue(r, "id"))
@@ -117,6 +239,10 @@ func authorize(r *http.Request) (subscription, error) {
 		return subscription{}, errNotFound
 	}
 
+	if jwks != nil && looksLikeJWT(authKey) {
+		return authorizeJWT(authKey, chanID, bone.GetValue(r, "subtopic"))
+	}
+
 	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
 	defer cancel()
 
@@ -126,52 +252,92 @@ func authorize(r *http.Request) (subscription, error) {
 	}
 
 	sub := subscription{
-		pubID:  id.GetValue(),
-		chanID: chanID,
+		pubID:    strconv.FormatUint(id.GetValue(), 10),
+		chanID:   chanID,
+		subtopic: bone.GetValue(r, "subtopic"),
 	}
 
 	return sub, nil
 }
 
+// authorizeJWT validates token against the configured JWKS and, in place of
+// the Things CanAccess gRPC check, trusts its "sub" claim as the publisher
+// identity.
+func authorizeJWT(token string, chanID uint64, subtopic string) (subscription, error) {
+	sub, err := subFromJWT(jwks, token)
+	if err != nil {
+		return subscription{}, errUnauthorizedJWT
+	}
+
+	return subscription{
+		pubID:    sub,
+		chanID:   chanID,
+		subtopic: subtopic,
+	}, nil
+}
+
 type subscription struct {
-	pubID   uint64
-	chanID  uint64
-	conn    *websocket.Conn
-	channel ws.Channel
+	pubID    string
+	chanID   uint64
+	subtopic string
+	conn     *websocket.Conn
+	limiter  *rate.Limiter
 }
 
 func (sub subscription) broadcast(svc ws.Service) {
+	chanID := strconv.FormatUint(sub.chanID, 10)
+	defer svc.Unsubscribe(chanID, sub.subtopic)
+
 	for {
 		_, payload, err := sub.conn.ReadMessage()
 		if websocket.IsUnexpectedCloseError(err) {
-			sub.channel.Closed <- true
 			return
 		}
 		if err != nil {
+			if isMessageTooLarge(err) {
+				msgsDropped.Inc()
+				closeWithCode(sub.conn, websocket.CloseMessageTooBig, "message too large")
+				return
+			}
 			logger.Warn(fmt.Sprintf("Failed to read message: %s", err))
 			return
 		}
-		msg := mainflux.RawMessage{
-			Channel:   sub.chanID,
-			Publisher: sub.pubID,
-			Protocol:  protocol,
-			Payload:   payload,
+
+		if !sub.limiter.Allow() {
+			rateLimited.Inc()
+			closeWithCode(sub.conn, websocket.CloseTryAgainLater, "rate limit exceeded")
+			return
+		}
+		msg := messaging.Message{
+			Channel:     chanID,
+			Subtopic:    sub.subtopic,
+			Publisher:   sub.pubID,
+			Protocol:    protocol,
+			Payload:     payload,
+			ContentType: defContentType,
+			Created:     time.Now().UnixNano(),
 		}
 		if err := svc.Publish(msg); err != nil {
-			logger.Warn(fmt.Sprintf("Failed to publish message to NATS: %s", err))
+			logger.Warn(fmt.Sprintf("Failed to publish message to broker: %s", err))
 			if err == ws.ErrFailedConnection {
 				sub.conn.Close()
-				sub.channel.Closed <- true
 				return
 			}
 		}
 	}
 }
 
-func (sub subscription) listen() {
-	for msg := range sub.channel.Messages {
-		if err := sub.conn.WriteMessage(websocket.TextMessage, msg.Payload); err != nil {
-			logger.Warn(fmt.Sprintf("Failed to broadcast message to thing: %s", err))
-		}
-	}
+// isMessageTooLarge reports whether err was caused by a message exceeding
+// the connection's read limit set via conn.SetReadLimit.
+func isMessageTooLarge(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "read limit exceeded")
+}
+
+// closeWithCode sends a WebSocket close frame carrying code and text, then
+// closes the underlying connection.
+func closeWithCode(conn *websocket.Conn, code int, text string) {
+	deadline := time.Now().Add(time.Second)
+	msg := websocket.FormatCloseMessage(code, text)
+	conn.WriteControl(websocket.CloseMessage, msg, deadline)
+	conn.Close()
 }
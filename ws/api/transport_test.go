@@ -0,0 +1,27 @@
+package api
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestIsMessageTooLarge(t *testing.T) {
+	cases := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"nil error", nil, false},
+		{"unrelated error", errors.New("connection reset by peer"), false},
+		{"read limit exceeded", errors.New("read limit exceeded"), true},
+		{"wrapped read limit exceeded", errors.New("websocket: read limit exceeded"), true},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := isMessageTooLarge(tc.err); got != tc.want {
+				t.Errorf("isMessageTooLarge(%v) = %v, want %v", tc.err, got, tc.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,84 @@
+package ws
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/mainflux/mainflux/messaging"
+)
+
+// ErrFailedConnection indicates that service couldn't connect to message broker.
+var ErrFailedConnection = errors.New("failed to connect to message broker")
+
+// Service specifies web socket service API.
+type Service interface {
+	// Publish publishes message to the broker.
+	Publish(msg messaging.Message) error
+
+	// Subscribe subscribes to chanID, optionally scoped to subtopic, and
+	// invokes handler for every message received on it, regardless of the
+	// broker backing the subscription. An empty subtopic subscribes to the
+	// whole channel.
+	Subscribe(chanID, subtopic string, handler messaging.MessageHandler) error
+
+	// Unsubscribe cancels a previously established subscription to chanID/subtopic.
+	Unsubscribe(chanID, subtopic string) error
+}
+
+type adapterService struct {
+	pubsub messaging.PubSub
+}
+
+// New instantiates the WS adapter implementation.
+func New(pubsub messaging.PubSub) Service {
+	return &adapterService{pubsub: pubsub}
+}
+
+func (as *adapterService) Publish(msg messaging.Message) error {
+	topic := subject(msg.Channel, msg.Subtopic)
+	if err := as.pubsub.Publish(topic, msg); err != nil {
+		return ErrFailedConnection
+	}
+	return nil
+}
+
+func (as *adapterService) Subscribe(chanID, subtopic string, handler messaging.MessageHandler) error {
+	for _, subj := range subscribeSubjects(chanID, subtopic) {
+		if err := as.pubsub.Subscribe(subj, handler); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (as *adapterService) Unsubscribe(chanID, subtopic string) error {
+	for _, subj := range subscribeSubjects(chanID, subtopic) {
+		if err := as.pubsub.Unsubscribe(subj); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// subject builds the exact broker subject a message with the given channel
+// and subtopic is published on.
+func subject(chanID, subtopic string) string {
+	subj := fmt.Sprintf("channels.%s.messages", chanID)
+	if subtopic == "" {
+		return subj
+	}
+	return fmt.Sprintf("%s.%s", subj, strings.ReplaceAll(subtopic, "/", "."))
+}
+
+// subscribeSubjects builds the subjects a subscriber must listen on to
+// receive every message scoped to chanID/subtopic: the given subtopic's
+// own subtree, so that e.g. subscribing to "temperature" also receives
+// "temperature.in". The ">" wildcard only matches subjects with at least
+// one token beyond the prefix, so it never matches the bare subject a
+// message is published on when its subtopic is exactly the subscribed one;
+// that bare subject is therefore subscribed to as well.
+func subscribeSubjects(chanID, subtopic string) []string {
+	subj := subject(chanID, subtopic)
+	return []string{subj, subj + ".>"}
+}
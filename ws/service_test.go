@@ -0,0 +1,58 @@
+package ws
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSubject(t *testing.T) {
+	cases := []struct {
+		name     string
+		chanID   string
+		subtopic string
+		want     string
+	}{
+		{"no subtopic", "1", "", "channels.1.messages"},
+		{"subtopic", "1", "temperature", "channels.1.messages.temperature"},
+		{"nested subtopic", "1", "temperature/in", "channels.1.messages.temperature.in"},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := subject(tc.chanID, tc.subtopic); got != tc.want {
+				t.Errorf("subject(%q, %q) = %q, want %q", tc.chanID, tc.subtopic, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestSubscribeSubjects(t *testing.T) {
+	cases := []struct {
+		name     string
+		chanID   string
+		subtopic string
+		want     []string
+	}{
+		{
+			name:     "empty subtopic also subscribes to the bare channel subject",
+			chanID:   "1",
+			subtopic: "",
+			want:     []string{"channels.1.messages", "channels.1.messages.>"},
+		},
+		{
+			name:     "non-empty subtopic subscribes to its own subject and subtree",
+			chanID:   "1",
+			subtopic: "temperature",
+			want:     []string{"channels.1.messages.temperature", "channels.1.messages.temperature.>"},
+		},
+	}
+
+	for _, tc := range cases {
+		t.Run(tc.name, func(t *testing.T) {
+			got := subscribeSubjects(tc.chanID, tc.subtopic)
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("subscribeSubjects(%q, %q) = %v, want %v", tc.chanID, tc.subtopic, got, tc.want)
+			}
+		})
+	}
+}